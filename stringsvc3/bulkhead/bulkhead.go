@@ -0,0 +1,59 @@
+// Package bulkhead bounds how many calls to an endpoint can be in flight
+// at once, so one slow instance can't queue up unboundedly many goroutines.
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+)
+
+// ErrLimited is what a caller sees when NewConcurrencyLimiter turns them
+// away: either every slot was already taken and there was no maxWait to
+// fall back on, or one never freed up within maxWait.
+var ErrLimited = errors.New("bulkhead: concurrency limit reached")
+
+// NewConcurrencyLimiter returns an endpoint.Middleware that allows at most
+// max calls through the wrapped endpoint at once, failing fast with
+// ErrLimited once a call has waited maxWait for a free slot (maxWait <= 0
+// means fail immediately instead of waiting). Pass a non-nil gauge to have
+// the current in-flight count mirrored onto it.
+func NewConcurrencyLimiter(max int, maxWait time.Duration, gauge metrics.Gauge) endpoint.Middleware {
+	slots := make(chan struct{}, max)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if maxWait <= 0 {
+				// fail fast instead of queuing
+				select {
+				case slots <- struct{}{}:
+				default:
+					return nil, ErrLimited
+				}
+			} else {
+				waitCtx, cancel := context.WithTimeout(ctx, maxWait)
+				defer cancel()
+				select {
+				case slots <- struct{}{}:
+				case <-waitCtx.Done():
+					return nil, ErrLimited
+				}
+			}
+
+			if gauge != nil {
+				gauge.Add(1)
+			}
+			// release the slot (and update the gauge) no matter how next returns
+			defer func() {
+				<-slots
+				if gauge != nil {
+					gauge.Add(-1)
+				}
+			}()
+
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package client lets other programs consume a remote StringService
+// instance without copying the endpoint/transport plumbing that used to be
+// hand-rolled inside proxyingMiddleware.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/sony/gobreaker"
+	"golang.org/x/time/rate"
+
+	"github.com/go-kit/kit/circuitbreaker"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+	kitot "github.com/go-kit/kit/tracing/opentracing"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/tomschdev/go-kit-examples/stringsvc3/bulkhead"
+	"github.com/tomschdev/go-kit-examples/stringsvc3/stringsvc"
+)
+
+// ClientOption configures a client constructed by New.
+type ClientOption func(*options)
+
+type options struct {
+	breaker       gobreaker.Settings
+	maxInflight   int
+	maxWait       time.Duration
+	inflightGauge metrics.Gauge
+	qps           int
+	maxAttempts   int
+	maxTime       time.Duration
+	logger        log.Logger
+	tracer        opentracing.Tracer
+}
+
+func defaultOptions() options {
+	return options{
+		breaker:     gobreaker.Settings{},
+		maxInflight: 0,
+		qps:         100,
+		maxAttempts: 3,
+		maxTime:     250 * time.Millisecond,
+		logger:      log.NewNopLogger(),
+		tracer:      opentracing.NoopTracer{},
+	}
+}
+
+// WithCircuitBreaker configures the gobreaker settings used to protect
+// calls to the remote instance.
+func WithCircuitBreaker(settings gobreaker.Settings) ClientOption {
+	return func(o *options) { o.breaker = settings }
+}
+
+// WithConcurrencyLimit bounds the number of concurrent in-flight calls to
+// the remote instance to max, failing fast with bulkhead.ErrLimited once
+// that many are outstanding, or after waiting up to maxWait for a slot if
+// maxWait is positive. A max of 0 (the default) disables the bulkhead.
+func WithConcurrencyLimit(max int, maxWait time.Duration) ClientOption {
+	return func(o *options) { o.maxInflight = max; o.maxWait = maxWait }
+}
+
+// WithInFlightGauge reports the current in-flight count to gauge while the
+// concurrency limit configured via WithConcurrencyLimit is in effect, so
+// operators can observe bulkhead saturation.
+func WithInFlightGauge(gauge metrics.Gauge) ClientOption {
+	return func(o *options) { o.inflightGauge = gauge }
+}
+
+// WithQPS caps the rate of requests sent to the remote instance, beyond
+// which calls fail fast with a rate-limit error.
+func WithQPS(qps int) ClientOption {
+	return func(o *options) { o.qps = qps }
+}
+
+// WithRetry sets the number of attempts and the overall wallclock budget
+// per call.
+func WithRetry(maxAttempts int, maxTime time.Duration) ClientOption {
+	return func(o *options) { o.maxAttempts = maxAttempts; o.maxTime = maxTime }
+}
+
+// WithLogger sets the logger used to report client-side events.
+func WithLogger(logger log.Logger) ClientOption {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithTracer propagates the caller's span, if any, onto outgoing requests.
+func WithTracer(tracer opentracing.Tracer) ClientOption {
+	return func(o *options) { o.tracer = tracer }
+}
+
+// New returns a stringsvc.StringService backed by the remote instance
+// (host:port, or a full URL). Each method's endpoint is wrapped - innermost
+// first - in a circuit breaker, an optional bulkhead, a rate limiter, and
+// lb.Retry.
+func New(instance string, opts ...ClientOption) (stringsvc.StringService, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if !strings.HasPrefix(instance, "http") {
+		instance = "http://" + instance
+	}
+	base, err := url.Parse(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	// The bulkhead and the rate limiter are built once and shared by both
+	// methods, so their limits apply to the remote instance as a whole.
+	var inflightLimit endpoint.Middleware
+	if o.maxInflight > 0 {
+		inflightLimit = bulkhead.NewConcurrencyLimiter(o.maxInflight, o.maxWait, o.inflightGauge)
+	}
+	limiter := rate.NewLimiter(rate.Limit(o.qps), o.qps)
+
+	var uppercaseEndpoint endpoint.Endpoint
+	{
+		u := *base
+		u.Path = "/uppercase"
+		uppercaseEndpoint = httptransport.NewClient(
+			"GET",
+			&u,
+			encodeRequest,
+			decodeUppercaseResponse,
+			httptransport.ClientBefore(kitot.ContextToHTTP(o.tracer, o.logger)),
+		).Endpoint()
+		uppercaseEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(o.breaker))(uppercaseEndpoint)
+		if o.maxInflight > 0 {
+			// bulkhead is opt-in (maxInflight 0 means "don't bother") since
+			// most callers of this package are fine with just the breaker
+			// and rate limiter below
+			uppercaseEndpoint = inflightLimit(uppercaseEndpoint)
+		}
+		uppercaseEndpoint = ratelimit.NewErroringLimiter(limiter)(uppercaseEndpoint)
+		uppercaseEndpoint = lb.Retry(o.maxAttempts, o.maxTime, lb.NewRoundRobin(sd.FixedEndpointer{uppercaseEndpoint}))
+	}
+
+	// Count gets the identical stack, for the identical reasons, just
+	// pointed at a different path - see the uppercaseEndpoint block above.
+	var countEndpoint endpoint.Endpoint
+	{
+		u := *base
+		u.Path = "/count"
+		countEndpoint = httptransport.NewClient(
+			"GET",
+			&u,
+			encodeRequest,
+			decodeCountResponse,
+			httptransport.ClientBefore(kitot.ContextToHTTP(o.tracer, o.logger)),
+		).Endpoint()
+		countEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(o.breaker))(countEndpoint)
+		if o.maxInflight > 0 {
+			countEndpoint = inflightLimit(countEndpoint)
+		}
+		countEndpoint = ratelimit.NewErroringLimiter(limiter)(countEndpoint)
+		countEndpoint = lb.Retry(o.maxAttempts, o.maxTime, lb.NewRoundRobin(sd.FixedEndpointer{countEndpoint}))
+	}
+
+	return endpoints{uppercaseEndpoint, countEndpoint}, nil
+}
+
+// endpoints implements stringsvc.StringService by invoking the endpoints
+// built in New.
+type endpoints struct {
+	uppercaseEndpoint endpoint.Endpoint
+	countEndpoint     endpoint.Endpoint
+}
+
+func (e endpoints) Uppercase(ctx context.Context, s string) (string, error) {
+	resp, err := e.uppercaseEndpoint(ctx, uppercaseRequest{S: s})
+	if err != nil {
+		return "", err
+	}
+	response := resp.(uppercaseResponse)
+	if response.Err != "" {
+		return response.V, errors.New(response.Err)
+	}
+	return response.V, nil
+}
+
+func (e endpoints) Count(ctx context.Context, s string) int {
+	resp, err := e.countEndpoint(ctx, countRequest{S: s})
+	if err != nil {
+		return 0
+	}
+	return resp.(countResponse).V
+}
+
+type uppercaseRequest struct {
+	S string `json:"s"`
+}
+
+type uppercaseResponse struct {
+	V   string `json:"v"`
+	Err string `json:"err,omitempty"`
+}
+
+type countRequest struct {
+	S string `json:"s"`
+}
+
+type countResponse struct {
+	V int `json:"v"`
+}
+
+func encodeRequest(_ context.Context, r *http.Request, request interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(request); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(&buf)
+	return nil
+}
+
+func decodeUppercaseResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var response uppercaseResponse
+	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func decodeCountResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var response countResponse
+	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
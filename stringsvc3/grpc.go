@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	kitot "github.com/go-kit/kit/tracing/opentracing"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+
+	opentracing "github.com/opentracing/opentracing-go"
+
+	"github.com/tomschdev/go-kit-examples/stringsvc3/pb"
+)
+
+// grpcServer implements pb.StringServiceServer by wrapping the same
+// endpoints used by the HTTP transport, so that the logging middleware and
+// the endpoint tracing apply uniformly across both transports.
+type grpcServer struct {
+	uppercase grpctransport.Handler
+	count     grpctransport.Handler
+}
+
+func newGRPCServer(uppercaseEndpoint, countEndpoint endpoint.Endpoint, tracer opentracing.Tracer, logger log.Logger) pb.StringServiceServer {
+	return &grpcServer{
+		uppercase: grpctransport.NewServer(
+			uppercaseEndpoint,
+			decodeGRPCUppercaseRequest,
+			encodeGRPCUppercaseResponse,
+			grpctransport.ServerBefore(kitot.GRPCToContext(tracer, "uppercase", logger)),
+		),
+		count: grpctransport.NewServer(
+			countEndpoint,
+			decodeGRPCCountRequest,
+			encodeGRPCCountResponse,
+			grpctransport.ServerBefore(kitot.GRPCToContext(tracer, "count", logger)),
+		),
+	}
+}
+
+func (s *grpcServer) Uppercase(ctx context.Context, req *pb.UppercaseRequest) (*pb.UppercaseReply, error) {
+	_, rep, err := s.uppercase.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.UppercaseReply), nil
+}
+
+func (s *grpcServer) Count(ctx context.Context, req *pb.CountRequest) (*pb.CountReply, error) {
+	_, rep, err := s.count.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.CountReply), nil
+}
+
+func decodeGRPCUppercaseRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.UppercaseRequest)
+	return uppercaseRequest{S: req.S}, nil
+}
+
+func encodeGRPCUppercaseResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(uppercaseResponse)
+	return &pb.UppercaseReply{V: resp.V, Err: resp.Err}, nil
+}
+
+func decodeGRPCCountRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.CountRequest)
+	return countRequest{S: req.S}, nil
+}
+
+func encodeGRPCCountResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(countResponse)
+	return &pb.CountReply{V: int64(resp.V)}, nil
+}
+
+// serveGRPC blocks, serving srv on addr until the listener errors out.
+func serveGRPC(addr string, srv pb.StringServiceServer, logger log.Logger) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	baseServer := grpc.NewServer()
+	pb.RegisterStringServiceServer(baseServer, srv)
+	logger.Log("msg", "gRPC", "addr", addr)
+	return baseServer.Serve(listener)
+}
+
+// encodeGRPCUppercaseRequest and decodeGRPCUppercaseReply are the
+// client-side counterparts used when proxying over gRPC instead of HTTP.
+func encodeGRPCUppercaseRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(uppercaseRequest)
+	return &pb.UppercaseRequest{S: req.S}, nil
+}
+
+func decodeGRPCUppercaseReply(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.UppercaseReply)
+	return uppercaseResponse{V: reply.V, Err: reply.Err}, nil
+}
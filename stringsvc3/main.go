@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	kitot "github.com/go-kit/kit/tracing/opentracing"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/tomschdev/go-kit-examples/stringsvc3/stringsvc"
+	kittracing "github.com/tomschdev/go-kit-examples/stringsvc3/tracing"
+)
+
+// StringService is an alias for stringsvc.StringService, kept so the rest
+// of this package (and the sibling proxying/grpc files) can keep referring
+// to it as StringService without a qualifier.
+type StringService = stringsvc.StringService
+
+// stringService is a concrete implementation of StringService.
+type stringService struct{}
+
+func (stringService) Uppercase(_ context.Context, s string) (string, error) {
+	if s == "" {
+		return "", ErrEmpty
+	}
+	return strings.ToUpper(s), nil
+}
+
+func (stringService) Count(_ context.Context, s string) int {
+	return len(s)
+}
+
+// ErrEmpty is returned when an input string is empty.
+var ErrEmpty = errors.New("empty string")
+
+// ServiceMiddleware is a chainable behavior modifier for StringService.
+type ServiceMiddleware func(StringService) StringService
+
+// loggingMiddleware logs every request made to the wrapped StringService.
+type loggingMiddleware struct {
+	logger log.Logger
+	next   StringService
+}
+
+func (mw loggingMiddleware) Uppercase(ctx context.Context, s string) (output string, err error) {
+	defer func() {
+		mw.logger.Log("method", "uppercase", "input", s, "output", output, "err", err)
+	}()
+	return mw.next.Uppercase(ctx, s)
+}
+
+func (mw loggingMiddleware) Count(ctx context.Context, s string) (n int) {
+	defer func() {
+		mw.logger.Log("method", "count", "input", s, "n", n)
+	}()
+	return mw.next.Count(ctx, s)
+}
+
+type uppercaseRequest struct {
+	S string `json:"s"`
+}
+
+type uppercaseResponse struct {
+	V   string `json:"v"`
+	Err string `json:"err,omitempty"`
+}
+
+type countRequest struct {
+	S string `json:"s"`
+}
+
+type countResponse struct {
+	V int `json:"v"`
+}
+
+func makeUppercaseEndpoint(svc StringService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(uppercaseRequest)
+		v, err := svc.Uppercase(ctx, req.S)
+		if err != nil {
+			return uppercaseResponse{v, err.Error()}, nil
+		}
+		return uppercaseResponse{v, ""}, nil
+	}
+}
+
+func makeCountEndpoint(svc StringService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(countRequest)
+		v := svc.Count(ctx, req.S)
+		return countResponse{v}, nil
+	}
+}
+
+func main() {
+	var (
+		httpAddr       = flag.String("http.addr", ":8080", "HTTP listen address")
+		grpcAddr       = flag.String("grpc.addr", ":8081", "gRPC listen address")
+		proxyTo        = flag.String("proxy.instances", "", "Comma-separated list of upstream instances to proxy uppercase requests to")
+		proxyProtocol  = flag.String("proxy.protocol", "http", "Protocol to use when proxying to upstream instances: http or grpc")
+		proxyMaxInflt  = flag.Int("proxy.maxInflight", 0, "Maximum number of concurrent in-flight requests per proxied instance (0 disables the bulkhead)")
+		proxyMaxWait   = flag.Duration("proxy.maxInflightWait", 0, "How long to wait for a free in-flight slot before failing, when proxy.maxInflight is set")
+		consulAddr     = flag.String("consul.addr", "", "Consul agent address (enables service-discovery-backed proxying)")
+		consulSvc      = flag.String("consul.service", "", "Consul service name to discover for proxying")
+		consulTag      = flag.String("consul.tag", "", "Consul tag to filter discovered instances by")
+		tracingBackend = flag.String("tracing.backend", "", "Tracing backend to use: jaeger, zipkin, or empty to disable")
+		tracingAddr    = flag.String("tracing.addr", "", "Address of the tracing backend (Jaeger agent host:port, or Zipkin collector URL)")
+	)
+	flag.Parse()
+
+	ctx := context.Background()
+	logger := log.NewLogfmtLogger(os.Stderr)
+
+	tracer, tracerCloser := newTracer("stringsvc", *tracingBackend, *tracingAddr, logger)
+	defer tracerCloser.Close()
+
+	inflightGauge := kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "stringsvc",
+		Subsystem: "proxy",
+		Name:      "inflight_requests",
+		Help:      "Current number of in-flight requests per proxied instance.",
+	}, []string{"instance"})
+
+	proxyCfg := proxyConfig{
+		protocol:      *proxyProtocol,
+		maxInflight:   *proxyMaxInflt,
+		maxWait:       *proxyMaxWait,
+		inflightGauge: inflightGauge,
+		tracer:        tracer,
+		logger:        logger,
+	}
+
+	var svc StringService
+	svc = stringService{}
+	switch {
+	case *consulAddr != "" && *consulSvc != "":
+		svc = proxyingMiddlewareConsul(ctx, *consulSvc, *consulTag, *consulAddr, proxyCfg)(svc)
+	default:
+		svc = proxyingMiddleware(ctx, *proxyTo, proxyCfg)(svc)
+	}
+	svc = loggingMiddleware{logger, svc}
+
+	var uppercaseEndpoint endpoint.Endpoint
+	uppercaseEndpoint = makeUppercaseEndpoint(svc)
+	uppercaseEndpoint = kittracing.TraceServer(tracer, "uppercase")(uppercaseEndpoint)
+
+	var countEndpoint endpoint.Endpoint
+	countEndpoint = makeCountEndpoint(svc)
+	countEndpoint = kittracing.TraceServer(tracer, "count")(countEndpoint)
+
+	uppercaseHandler := httptransport.NewServer(
+		uppercaseEndpoint,
+		decodeUppercaseRequest,
+		encodeResponse,
+		httptransport.ServerBefore(kitot.HTTPToContext(tracer, "uppercase", logger)),
+	)
+
+	countHandler := httptransport.NewServer(
+		countEndpoint,
+		decodeCountRequest,
+		encodeResponse,
+		httptransport.ServerBefore(kitot.HTTPToContext(tracer, "count", logger)),
+	)
+
+	http.Handle("/uppercase", uppercaseHandler)
+	http.Handle("/count", countHandler)
+	http.Handle("/metrics", promhttp.Handler())
+
+	grpcServer := newGRPCServer(uppercaseEndpoint, countEndpoint, tracer, logger)
+
+	errs := make(chan error, 2)
+	go func() {
+		logger.Log("msg", "HTTP", "addr", *httpAddr)
+		errs <- http.ListenAndServe(*httpAddr, nil)
+	}()
+	go func() {
+		errs <- serveGRPC(*grpcAddr, grpcServer, logger)
+	}()
+	logger.Log("err", <-errs)
+}
+
+func decodeUppercaseRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request uppercaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func decodeCountRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request countRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func encodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	return json.NewEncoder(w).Encode(response)
+}
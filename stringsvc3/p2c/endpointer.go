@@ -0,0 +1,136 @@
+package p2c
+
+import (
+	"io"
+	"sync"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+)
+
+// Endpointer supplies the current set of endpoints the Balancer should
+// choose between, each tagged with the instance ID it was built for.
+//
+// This is a narrower analogue of github.com/go-kit/kit/sd.Endpointer.
+// sd.Endpointer.Endpoints() returns a bare []endpoint.Endpoint, with no way
+// to recover which instance a given endpoint came from - exactly the
+// identity Balancer.snapshot needs to track load per instance across
+// calls, and exactly what broke when we tried to substitute the closure's
+// own reflect-derived code pointer for it instead. There's no way to
+// recover a missing identity after the fact, so rather than patch around
+// it we ask whoever builds the endpoint list to hand us the ID up front.
+type Endpointer interface {
+	Endpoints() ([]Instance, error)
+}
+
+// Instance pairs an endpoint with the instance string it was built for.
+type Instance struct {
+	ID       string
+	Endpoint endpoint.Endpoint
+}
+
+// FixedEndpointer is a static Endpointer that never changes - the p2c
+// analogue of sd.FixedEndpointer, for the plain comma-separated instance
+// list proxyingMiddleware builds.
+type FixedEndpointer []Instance
+
+// Endpoints implements Endpointer.
+func (fe FixedEndpointer) Endpoints() ([]Instance, error) { return fe, nil }
+
+// instanceEndpoint is what endpointCache keeps per instance: the endpoint
+// built for it, and whatever needs closing (e.g. a dialed gRPC connection)
+// once the instance drops out of the Instancer's set.
+type instanceEndpoint struct {
+	endpoint endpoint.Endpoint
+	closer   io.Closer
+}
+
+// endpointCache mirrors what go-kit's own (unexported) sd.endpointCache
+// does for sd.NewEndpointer - subscribe to the Instancer, rebuild on every
+// sd.Event, close whatever got dropped - except it keeps each built
+// endpoint tagged with the instance string it came from instead of
+// discarding it, which is the one thing sd.Endpointer can't give us back.
+type endpointCache struct {
+	factory sd.Factory
+	logger  log.Logger
+
+	mtx       sync.RWMutex
+	instances map[string]instanceEndpoint
+}
+
+// NewEndpointer returns an Endpointer that stays in sync with instancer,
+// building and tearing down endpoints via factory exactly as
+// sd.NewEndpointer does - this is the p2c.Balancer-compatible counterpart
+// of it, used by proxyingMiddlewareConsul in place of sd.NewEndpointer.
+// Like sd.NewEndpointer, it does not block for the first event: Endpoints
+// may return an empty set until instancer reports in.
+func NewEndpointer(instancer sd.Instancer, factory sd.Factory, logger log.Logger) Endpointer {
+	c := &endpointCache{
+		factory:   factory,
+		logger:    logger,
+		instances: map[string]instanceEndpoint{},
+	}
+
+	ch := make(chan sd.Event)
+	// loop must already be receiving before we Register: Register sends the
+	// current state into ch synchronously, and ch is unbuffered, so calling
+	// Register first would deadlock with nothing reading yet.
+	go c.loop(ch)
+	instancer.Register(ch)
+	return c
+}
+
+func (c *endpointCache) loop(ch chan sd.Event) {
+	for event := range ch {
+		c.update(event)
+	}
+}
+
+// update reconciles the cache against the latest reported instance set:
+// build an endpoint for anything new, and close/drop anything that's gone.
+func (c *endpointCache) update(event sd.Event) {
+	if event.Err != nil {
+		c.logger.Log("err", event.Err)
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	seen := make(map[string]struct{}, len(event.Instances))
+	for _, instance := range event.Instances {
+		seen[instance] = struct{}{}
+		if _, ok := c.instances[instance]; ok {
+			continue
+		}
+		e, closer, err := c.factory(instance)
+		if err != nil {
+			c.logger.Log("instance", instance, "err", err)
+			continue
+		}
+		c.instances[instance] = instanceEndpoint{endpoint: e, closer: closer}
+	}
+
+	for instance, ie := range c.instances {
+		if _, ok := seen[instance]; ok {
+			continue
+		}
+		if ie.closer != nil {
+			ie.closer.Close()
+		}
+		delete(c.instances, instance)
+	}
+}
+
+// Endpoints implements Endpointer.
+func (c *endpointCache) Endpoints() ([]Instance, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	instances := make([]Instance, 0, len(c.instances))
+	for id, ie := range c.instances {
+		instances = append(instances, Instance{ID: id, Endpoint: ie.endpoint})
+	}
+	return instances, nil
+}
@@ -0,0 +1,166 @@
+// Package p2c implements a power-of-two-choices load balancer, a drop-in
+// replacement for github.com/go-kit/kit/sd/lb's round robin: each call
+// samples two candidates at random and routes to whichever looks less
+// loaded, rather than spreading load blindly across every instance.
+package p2c
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// ewmaAlpha weights how quickly the latency estimate reacts to new
+// samples; smaller values smooth out noise at the cost of responsiveness.
+const ewmaAlpha = 0.1
+
+// ErrNoEndpoints is returned when the underlying Endpointer currently has
+// no endpoints to choose from.
+var ErrNoEndpoints = errors.New("p2c: no endpoints available")
+
+// trackedEndpoint decorates an endpoint.Endpoint with an in-flight request
+// counter and an exponentially weighted moving average of observed
+// latency, both updated on every call.
+type trackedEndpoint struct {
+	endpoint endpoint.Endpoint
+	inflight int64
+	ewmaBits uint64 // math.Float64bits of the current EWMA, 0 until the first sample
+}
+
+// Balancer implements lb.Balancer, so it slots into lb.Retry exactly where
+// lb.NewRoundRobin used to. Endpoint picks two candidates at random and
+// returns whichever has fewer in-flight requests, ties broken by latency.
+type Balancer struct {
+	endpointer Endpointer
+
+	mu    sync.Mutex
+	cache map[string]*trackedEndpoint
+}
+
+// NewP2C returns a power-of-two-choices Balancer over endpointer.
+func NewP2C(endpointer Endpointer) *Balancer {
+	return &Balancer{
+		endpointer: endpointer,
+		cache:      map[string]*trackedEndpoint{},
+	}
+}
+
+// Endpoint implements lb.Balancer. lb.Retry calls this once per attempt, so
+// a retried request gets to reroll the two-candidate draw rather than being
+// stuck with the same pick.
+func (b *Balancer) Endpoint() (endpoint.Endpoint, error) {
+	tracked, err := b.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if len(tracked) == 1 {
+		// nothing to choose between - just hand back the one we have
+		return tracked[0].wrapped(), nil
+	}
+
+	// draw two distinct indices uniformly at random: pick i freely, then pick
+	// j from what's left and shift it past i if it would collide
+	i := rand.Intn(len(tracked))
+	j := rand.Intn(len(tracked) - 1)
+	if j >= i {
+		j++
+	}
+
+	choice := tracked[i]
+	if lessLoaded(tracked[j], choice) {
+		choice = tracked[j]
+	}
+	return choice.wrapped(), nil
+}
+
+// snapshot returns the tracker for every endpoint currently reported by the
+// Endpointer, keyed by Instance.ID so in-flight count and EWMA latency
+// survive across snapshots rather than resetting on every Consul update.
+func (b *Balancer) snapshot() ([]*trackedEndpoint, error) {
+	instances, err := b.endpointer.Endpoints()
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) <= 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tracked := make([]*trackedEndpoint, len(instances))
+	seen := make(map[string]struct{}, len(instances))
+	for i, inst := range instances {
+		seen[inst.ID] = struct{}{}
+		t, ok := b.cache[inst.ID]
+		if !ok {
+			t = &trackedEndpoint{endpoint: inst.Endpoint}
+			b.cache[inst.ID] = t
+		}
+		tracked[i] = t
+	}
+
+	// drop trackers for instances that are no longer reported, so a churning
+	// Endpointer (e.g. Consul deregistering instances) doesn't leak one
+	// trackedEndpoint per instance that's ever existed.
+	for id := range b.cache {
+		if _, ok := seen[id]; !ok {
+			delete(b.cache, id)
+		}
+	}
+
+	return tracked, nil
+}
+
+// wrapped returns an endpoint.Endpoint that calls through to t.endpoint
+// while maintaining t's in-flight counter and EWMA latency - this is the
+// bookkeeping that makes lessLoaded's comparisons mean anything.
+func (t *trackedEndpoint) wrapped() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		atomic.AddInt64(&t.inflight, 1)
+		start := time.Now()
+		defer func() {
+			atomic.AddInt64(&t.inflight, -1)
+			t.observe(time.Since(start).Seconds())
+		}()
+		return t.endpoint(ctx, request)
+	}
+}
+
+func lessLoaded(x, y *trackedEndpoint) bool {
+	xi, yi := atomic.LoadInt64(&x.inflight), atomic.LoadInt64(&y.inflight)
+	if xi != yi {
+		return xi < yi
+	}
+	return x.latency() < y.latency()
+}
+
+func (t *trackedEndpoint) latency() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&t.ewmaBits))
+}
+
+// observe folds sample into the EWMA. There's no mutex here on purpose:
+// trackedEndpoint is shared by every concurrent call against that instance,
+// and a float64 behind a CAS loop lets us update it without making every
+// one of those calls serialize on a lock just to report its latency.
+func (t *trackedEndpoint) observe(sample float64) {
+	for {
+		oldBits := atomic.LoadUint64(&t.ewmaBits)
+		old := math.Float64frombits(oldBits)
+		next := sample
+		if old != 0 {
+			next = ewmaAlpha*sample + (1-ewmaAlpha)*old
+		}
+		if atomic.CompareAndSwapUint64(&t.ewmaBits, oldBits, math.Float64bits(next)) {
+			return
+		}
+		// someone else's observe() landed between our load and our CAS - the
+		// bits we tried to replace are stale, retry against the new value
+	}
+}
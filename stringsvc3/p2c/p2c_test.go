@@ -0,0 +1,112 @@
+package p2c
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+func TestP2CPrefersFastInstance(t *testing.T) {
+	var fastCount, slowCount int64
+
+	fast := func(context.Context, interface{}) (interface{}, error) {
+		atomic.AddInt64(&fastCount, 1)
+		return nil, nil
+	}
+	slow := func(context.Context, interface{}) (interface{}, error) {
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt64(&slowCount, 1)
+		return nil, nil
+	}
+
+	endpointer := FixedEndpointer{
+		{ID: "fast", Endpoint: endpoint.Endpoint(fast)},
+		{ID: "slow", Endpoint: endpoint.Endpoint(slow)},
+	}
+	balancer := NewP2C(endpointer)
+
+	const calls = 300
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e, err := balancer.Endpoint()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			e(context.Background(), nil)
+		}()
+	}
+	wg.Wait()
+
+	if fastCount <= slowCount {
+		t.Fatalf("expected fast instance to serve materially more requests than slow instance, got fast=%d slow=%d", fastCount, slowCount)
+	}
+	if fastCount < 2*slowCount {
+		t.Fatalf("expected fast instance to serve at least twice as many requests as slow instance, got fast=%d slow=%d", fastCount, slowCount)
+	}
+}
+
+func TestP2CNoEndpoints(t *testing.T) {
+	balancer := NewP2C(FixedEndpointer{})
+	if _, err := balancer.Endpoint(); err != ErrNoEndpoints {
+		t.Fatalf("expected ErrNoEndpoints, got %v", err)
+	}
+}
+
+// TestP2CTracksInstancesBuiltFromSharedClosure guards against the bug where
+// snapshot used to key its cache off reflect.ValueOf(endpoint).Pointer():
+// every instance in this codebase is built by calling the very same factory
+// closure once per instance (see makeProxyEndpoint, uppercaseFactory), so a
+// reflect-pointer key collapsed every instance built that way into a single
+// cache entry and the balancer ended up routing all traffic to whichever one
+// got cached first. A test built from N textually distinct closure literals
+// can't catch that, because each literal already has its own code pointer -
+// so this one builds both instances from one shared factory closure instead,
+// the same way the production call sites do.
+func TestP2CTracksInstancesBuiltFromSharedClosure(t *testing.T) {
+	counts := struct {
+		mu sync.Mutex
+		m  map[string]int
+	}{m: map[string]int{}}
+
+	factory := func(id string) Instance {
+		return Instance{
+			ID: id,
+			Endpoint: func(context.Context, interface{}) (interface{}, error) {
+				counts.mu.Lock()
+				counts.m[id]++
+				counts.mu.Unlock()
+				return nil, nil
+			},
+		}
+	}
+
+	endpointer := FixedEndpointer{factory("a"), factory("b")}
+	balancer := NewP2C(endpointer)
+
+	const calls = 50
+	for i := 0; i < calls; i++ {
+		e, err := balancer.Endpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e(context.Background(), nil)
+	}
+
+	if got := len(balancer.cache); got != 2 {
+		t.Fatalf("expected balancer to track 2 distinct instances built from the shared factory closure, got %d", got)
+	}
+
+	counts.mu.Lock()
+	defer counts.mu.Unlock()
+	if counts.m["a"] == 0 || counts.m["b"] == 0 {
+		t.Fatalf("expected both instances to receive traffic, got %v", counts.m)
+	}
+}
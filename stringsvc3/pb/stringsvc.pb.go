@@ -0,0 +1,179 @@
+// Hand-maintained stub for stringsvc.proto.
+//
+// This is NOT protoc-gen-go output - nothing in this repo regenerates it.
+// If you change stringsvc.proto, update the types and gRPC client/server
+// code below to match by hand.
+
+package pb
+
+import (
+	context "context"
+	fmt "fmt"
+
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+)
+
+type UppercaseRequest struct {
+	S string `protobuf:"bytes,1,opt,name=s,proto3" json:"s,omitempty"`
+}
+
+func (m *UppercaseRequest) Reset()         { *m = UppercaseRequest{} }
+func (m *UppercaseRequest) String() string { return fmt.Sprintf("%+v", *m) }
+func (*UppercaseRequest) ProtoMessage()    {}
+
+func (m *UppercaseRequest) GetS() string {
+	if m != nil {
+		return m.S
+	}
+	return ""
+}
+
+type UppercaseReply struct {
+	V   string `protobuf:"bytes,1,opt,name=v,proto3" json:"v,omitempty"`
+	Err string `protobuf:"bytes,2,opt,name=err,proto3" json:"err,omitempty"`
+}
+
+func (m *UppercaseReply) Reset()         { *m = UppercaseReply{} }
+func (m *UppercaseReply) String() string { return fmt.Sprintf("%+v", *m) }
+func (*UppercaseReply) ProtoMessage()    {}
+
+func (m *UppercaseReply) GetV() string {
+	if m != nil {
+		return m.V
+	}
+	return ""
+}
+
+func (m *UppercaseReply) GetErr() string {
+	if m != nil {
+		return m.Err
+	}
+	return ""
+}
+
+type CountRequest struct {
+	S string `protobuf:"bytes,1,opt,name=s,proto3" json:"s,omitempty"`
+}
+
+func (m *CountRequest) Reset()         { *m = CountRequest{} }
+func (m *CountRequest) String() string { return fmt.Sprintf("%+v", *m) }
+func (*CountRequest) ProtoMessage()    {}
+
+func (m *CountRequest) GetS() string {
+	if m != nil {
+		return m.S
+	}
+	return ""
+}
+
+type CountReply struct {
+	V int64 `protobuf:"varint,1,opt,name=v,proto3" json:"v,omitempty"`
+}
+
+func (m *CountReply) Reset()         { *m = CountReply{} }
+func (m *CountReply) String() string { return fmt.Sprintf("%+v", *m) }
+func (*CountReply) ProtoMessage()    {}
+
+func (m *CountReply) GetV() int64 {
+	if m != nil {
+		return m.V
+	}
+	return 0
+}
+
+var (
+	_ proto.Message = (*UppercaseRequest)(nil)
+	_ proto.Message = (*UppercaseReply)(nil)
+	_ proto.Message = (*CountRequest)(nil)
+	_ proto.Message = (*CountReply)(nil)
+)
+
+// StringServiceClient is the client API for StringService service.
+type StringServiceClient interface {
+	Uppercase(ctx context.Context, in *UppercaseRequest, opts ...grpc.CallOption) (*UppercaseReply, error)
+	Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountReply, error)
+}
+
+type stringServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewStringServiceClient(cc *grpc.ClientConn) StringServiceClient {
+	return &stringServiceClient{cc}
+}
+
+func (c *stringServiceClient) Uppercase(ctx context.Context, in *UppercaseRequest, opts ...grpc.CallOption) (*UppercaseReply, error) {
+	out := new(UppercaseReply)
+	err := c.cc.Invoke(ctx, "/pb.StringService/Uppercase", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *stringServiceClient) Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountReply, error) {
+	out := new(CountReply)
+	err := c.cc.Invoke(ctx, "/pb.StringService/Count", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StringServiceServer is the server API for StringService service.
+type StringServiceServer interface {
+	Uppercase(context.Context, *UppercaseRequest) (*UppercaseReply, error)
+	Count(context.Context, *CountRequest) (*CountReply, error)
+}
+
+func RegisterStringServiceServer(s *grpc.Server, srv StringServiceServer) {
+	s.RegisterService(&_StringService_serviceDesc, srv)
+}
+
+func _StringService_Uppercase_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UppercaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StringServiceServer).Uppercase(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/pb.StringService/Uppercase"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StringServiceServer).Uppercase(ctx, req.(*UppercaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _StringService_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StringServiceServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/pb.StringService/Count"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StringServiceServer).Count(ctx, req.(*CountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _StringService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.StringService",
+	HandlerType: (*StringServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Uppercase",
+			Handler:    _StringService_Uppercase_Handler,
+		},
+		{
+			MethodName: "Count",
+			Handler:    _StringService_Count_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "stringsvc.proto",
+}
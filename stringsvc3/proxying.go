@@ -4,63 +4,133 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/url"
+	"io"
 	"strings"
 	"time"
 
+	consulapi "github.com/hashicorp/consul/api"
+	opentracing "github.com/opentracing/opentracing-go"
 	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
 
 	"github.com/sony/gobreaker"
 
 	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/sd"
+	consulsd "github.com/go-kit/kit/sd/consul"
 	"github.com/go-kit/kit/sd/lb"
-	httptransport "github.com/go-kit/kit/transport/http"
+	kitot "github.com/go-kit/kit/tracing/opentracing"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+
+	"github.com/tomschdev/go-kit-examples/stringsvc3/bulkhead"
+	stringsvcclient "github.com/tomschdev/go-kit-examples/stringsvc3/client"
+	"github.com/tomschdev/go-kit-examples/stringsvc3/p2c"
+	"github.com/tomschdev/go-kit-examples/stringsvc3/pb"
+)
+
+// Retry/rate-limit parameters shared by both the fixed-instance and the
+// Consul-backed proxying middlewares.
+const (
+	proxyQPS         = 100                    // beyond which we will return an error
+	proxyMaxAttempts = 3                      // per request, before giving up
+	proxyMaxTime     = 250 * time.Millisecond // wallclock time, before giving up
 )
 
-func proxyingMiddleware(ctx context.Context, instances string, logger log.Logger) ServiceMiddleware {
+// proxyConfig bundles the parameters needed to build a client-side endpoint
+// for a single proxied instance. It exists so that proxyingMiddleware,
+// proxyingMiddlewareConsul and their helpers don't have to keep growing
+// individual parameters every time a cross-cutting concern (tracing,
+// bulkheading, ...) is added.
+type proxyConfig struct {
+	protocol      string
+	maxInflight   int           // 0 disables the per-instance bulkhead
+	maxWait       time.Duration // how long to wait for a bulkhead slot before failing
+	inflightGauge metrics.Gauge // reports current in-flight count per instance, may be nil
+	tracer        opentracing.Tracer
+	logger        log.Logger
+}
+
+func proxyingMiddleware(ctx context.Context, instances string, cfg proxyConfig) ServiceMiddleware {
 	// If instances is empty, don't proxy.
 	if instances == "" {
-		logger.Log("proxy_to", "none")
+		cfg.logger.Log("proxy_to", "none")
 		return func(next StringService) StringService { return next } // returns a function that takes in Service and returns it - proxy skipped
 	}
 
-	// Set some parameters for our client.
-	var (
-		qps         = 100                    // beyond which we will return an error
-		maxAttempts = 3                      // per request, before giving up
-		maxTime     = 250 * time.Millisecond // wallclock time, before giving up
-	)
-
 	// Otherwise, construct an endpoint for each instance in the list, and add
 	// it to a fixed set of endpoints. In a real service, rather than doing this
 	// by hand, you'd probably use package sd's support for your service
 	// discovery system.
 	var (
 		instanceList = split(instances)
-		endpointer   sd.FixedEndpointer
+		endpointer   p2c.FixedEndpointer
 	)
-	logger.Log("proxy_to", fmt.Sprint(instanceList))
+	cfg.logger.Log("proxy_to", fmt.Sprint(instanceList))
 	for _, instance := range instanceList {
-		var e endpoint.Endpoint
-		e = makeUppercaseProxy(ctx, instance) // read more about this code block under Service Discovery and Load Balancing at https://gokit.io/examples/stringsvc.html
-		e = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(e)
-		e = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), qps))(e)
-		endpointer = append(endpointer, e)
+		// This fixed instance list lives for the lifetime of the process, so
+		// unlike uppercaseFactory below there's no churn event to release
+		// the Closer against; discard it.
+		ep, _, err := makeProxyEndpoint(ctx, instance, cfg)
+		if err != nil {
+			cfg.logger.Log("instance", instance, "err", err)
+			continue
+		}
+		endpointer = append(endpointer, p2c.Instance{ID: instance, Endpoint: ep})
 	}
 
 	// Now, build a single, retrying, load-balancing endpoint out of all of
-	// those individual endpoints.
-	balancer := lb.NewRoundRobin(endpointer)
-	retry := lb.Retry(maxAttempts, maxTime, balancer) // Note: lb.Retry returns endpoint.Endpoint, therefore it is eligible for proxymw uppercase field
+	// those individual endpoints. We use power-of-two-choices rather than
+	// plain round robin so a degraded instance doesn't keep receiving an
+	// equal share of traffic.
+	balancer := p2c.NewP2C(endpointer)
+	retry := lb.Retry(proxyMaxAttempts, proxyMaxTime, balancer) // Note: lb.Retry returns endpoint.Endpoint, therefore it is eligible for proxymw uppercase field
 
 	// And finally, return the ServiceMiddleware, implemented by proxymw.
 	// Note: this function that is returned, is the one invoked by the middleware chain with (svc)
 	return func(next StringService) StringService {
-		return proxymw{ctx, next, retry}
+		return proxymw{next, retry}
+	}
+}
+
+// proxyingMiddlewareConsul is the service-discovery-backed counterpart of
+// proxyingMiddleware. Rather than freezing a fixed set of instances at
+// startup, it subscribes to Consul for the given service/tag and keeps the
+// underlying Endpointer's endpoint set in sync with Consul's view of
+// healthy instances for the lifetime of the process.
+func proxyingMiddlewareConsul(ctx context.Context, service, tag, consulAddr string, cfg proxyConfig) ServiceMiddleware {
+	if service == "" {
+		cfg.logger.Log("proxy_to", "none")
+		return func(next StringService) StringService { return next }
+	}
+
+	apiClient, err := consulapi.NewClient(&consulapi.Config{Address: consulAddr})
+	if err != nil {
+		cfg.logger.Log("during", "consulapi.NewClient", "err", err)
+		return func(next StringService) StringService { return next }
+	}
+
+	var tags []string
+	if tag != "" {
+		tags = []string{tag}
+	}
+
+	var (
+		client     = consulsd.NewClient(apiClient)
+		instancer  = consulsd.NewInstancer(client, cfg.logger, service, tags, true)
+		factory    = uppercaseFactory(ctx, cfg)
+		endpointer = p2c.NewEndpointer(instancer, factory, cfg.logger)
+	)
+	cfg.logger.Log("proxy_to", "consul", "service", service, "tag", tag)
+
+	balancer := p2c.NewP2C(endpointer)
+	retry := lb.Retry(proxyMaxAttempts, proxyMaxTime, balancer)
+
+	return func(next StringService) StringService {
+		return proxymw{next, retry}
 	}
 }
 
@@ -68,14 +138,13 @@ func proxyingMiddleware(ctx context.Context, instances string, logger log.Logger
 // provided endpoint, and serving all other (i.e. Count) requests via the
 // next StringService.
 type proxymw struct {
-	ctx       context.Context
 	next      StringService     // Serve most requests via this service...
 	uppercase endpoint.Endpoint // ...except Uppercase, which gets served by this endpoint
 }
 
 // just refer to original StringService implementation
-func (mw proxymw) Count(s string) int {
-	return mw.next.Count(s)
+func (mw proxymw) Count(ctx context.Context, s string) int {
+	return mw.next.Count(ctx, s)
 }
 
 // divert to external endpoint held in new concrete type
@@ -83,8 +152,11 @@ func (mw proxymw) Count(s string) int {
 // i.e., we receive a string and put back into a request struct
 // and we extract a string from the response
 // this is because we interact with an endpoint inside this method, but we return to an endpoint which invokes this method
-func (mw proxymw) Uppercase(s string) (string, error) {
-	response, err := mw.uppercase(mw.ctx, uppercaseRequest{S: s}) // invoke endpoint held in proxymw - which will be the retry func configured in proxyingMiddleware
+func (mw proxymw) Uppercase(ctx context.Context, s string) (string, error) {
+	// ctx is the inbound request's context (the one TraceServer put a span
+	// into), not a ctx captured at startup - that's what lets the proxied
+	// call's ClientBefore hook find a span to propagate.
+	response, err := mw.uppercase(ctx, uppercaseRequest{S: s}) // invoke endpoint held in proxymw - which will be the retry func configured in proxyingMiddleware
 	// note extracted input which is fed to this function must once again be put into a request struct
 	if err != nil {
 		return "", err
@@ -97,23 +169,77 @@ func (mw proxymw) Uppercase(s string) (string, error) {
 	return resp.V, nil // return data field of response - endpoint which wraps this method will encode it into a struct
 }
 
-func makeUppercaseProxy(ctx context.Context, instance string) endpoint.Endpoint {
-	if !strings.HasPrefix(instance, "http") {
-		instance = "http://" + instance
+// makeProxyEndpoint builds the client-side endpoint for a single instance,
+// along with an io.Closer that releases whatever the endpoint is holding
+// onto (e.g. a dialed gRPC connection). The Closer is nil when there's
+// nothing to release, which is always true for the HTTP protocol today.
+func makeProxyEndpoint(ctx context.Context, instance string, cfg proxyConfig) (endpoint.Endpoint, io.Closer, error) {
+	if cfg.protocol == "grpc" {
+		return makeUppercaseProxyGRPC(ctx, instance, cfg)
+	}
+
+	opts := []stringsvcclient.ClientOption{
+		stringsvcclient.WithTracer(cfg.tracer),
+		stringsvcclient.WithLogger(cfg.logger),
+		// Retries belong solely to the outer lb.Retry in proxyingMiddleware,
+		// which can fail over to a different instance; a retrying inner
+		// client here would instead hammer this same instance several times
+		// before the outer balancer ever got a chance to pick another one.
+		stringsvcclient.WithRetry(1, proxyMaxTime),
+	}
+	if cfg.maxInflight > 0 {
+		opts = append(opts, stringsvcclient.WithConcurrencyLimit(cfg.maxInflight, cfg.maxWait))
+		if cfg.inflightGauge != nil {
+			opts = append(opts, stringsvcclient.WithInFlightGauge(cfg.inflightGauge.With("instance", instance)))
+		}
 	}
-	u, err := url.Parse(instance)
+
+	svc, err := stringsvcclient.New(instance, opts...)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
-	if u.Path == "" {
-		u.Path = "/uppercase"
+	return makeUppercaseEndpoint(svc), nil, nil
+}
+
+// makeUppercaseProxyGRPC is the gRPC counterpart of the client package,
+// dialing instance and invoking the generated StringService/Uppercase RPC.
+// The returned Closer closes the dialed connection; callers backed by
+// service discovery (see uppercaseFactory) must close it once the instance
+// is dropped, or the connection leaks.
+func makeUppercaseProxyGRPC(ctx context.Context, instance string, cfg proxyConfig) (endpoint.Endpoint, io.Closer, error) {
+	conn, err := grpc.Dial(instance, grpc.WithInsecure())
+	if err != nil {
+		return nil, nil, err
 	}
-	return httptransport.NewClient(
-		"GET",
-		u,
-		encodeRequest,
-		decodeUppercaseResponse,
+	e := grpctransport.NewClient(
+		conn,
+		"pb.StringService",
+		"Uppercase",
+		encodeGRPCUppercaseRequest,
+		decodeGRPCUppercaseReply,
+		pb.UppercaseReply{},
+		grpctransport.ClientBefore(kitot.ContextToGRPC(cfg.tracer, cfg.logger)),
 	).Endpoint()
+	e = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(e)
+	if cfg.maxInflight > 0 {
+		var gauge metrics.Gauge
+		if cfg.inflightGauge != nil {
+			gauge = cfg.inflightGauge.With("instance", instance)
+		}
+		e = bulkhead.NewConcurrencyLimiter(cfg.maxInflight, cfg.maxWait, gauge)(e)
+	}
+	e = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Limit(proxyQPS), proxyQPS))(e)
+	return e, conn, nil
+}
+
+// uppercaseFactory adapts makeProxyEndpoint into an sd.Factory, for use by
+// the Consul-backed Endpointer. Returning makeProxyEndpoint's error lets a
+// single malformed/unreachable instance reported by Consul fail to
+// register without taking down the whole endpointCache loop.
+func uppercaseFactory(ctx context.Context, cfg proxyConfig) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		return makeProxyEndpoint(ctx, instance, cfg)
+	}
 }
 
 func split(s string) []string {
@@ -0,0 +1,14 @@
+// Package stringsvc holds the StringService interface shared by the server
+// (stringsvc3, package main) and the client package, so that external
+// programs can depend on the interface without importing package main.
+package stringsvc
+
+import "context"
+
+// StringService provides operations on strings. Methods take a context so
+// a per-request span (or deadline) started at the inbound transport can
+// flow down through proxying middleware to an outbound client call.
+type StringService interface {
+	Uppercase(ctx context.Context, s string) (string, error)
+	Count(ctx context.Context, s string) int
+}
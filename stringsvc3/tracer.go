@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	zipkin "github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	zipkintracer "github.com/openzipkin-contrib/zipkin-go-opentracing"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+
+	"github.com/go-kit/kit/log"
+)
+
+// nopCloser satisfies io.Closer for tracer backends that don't need a
+// shutdown step (or when tracing is disabled).
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// newTracer constructs an opentracing.Tracer for the requested backend.
+// backend is one of "jaeger", "zipkin", or "" (disables tracing in favor
+// of a no-op tracer). The returned io.Closer must be closed on shutdown to
+// flush any buffered spans.
+func newTracer(serviceName, backend, addr string, logger log.Logger) (opentracing.Tracer, io.Closer) {
+	switch backend {
+	case "jaeger":
+		cfg := jaegercfg.Configuration{
+			ServiceName: serviceName,
+			Sampler: &jaegercfg.SamplerConfig{
+				Type:  "const",
+				Param: 1,
+			},
+			Reporter: &jaegercfg.ReporterConfig{
+				LocalAgentHostPort: addr,
+			},
+		}
+		tracer, closer, err := cfg.NewTracer()
+		if err != nil {
+			logger.Log("during", "jaeger.NewTracer", "err", err)
+			return opentracing.NoopTracer{}, nopCloser{}
+		}
+		return tracer, closer
+
+	case "zipkin":
+		reporter := zipkinhttp.NewReporter(addr)
+		endpoint, err := zipkin.NewEndpoint(serviceName, "")
+		if err != nil {
+			logger.Log("during", "zipkin.NewEndpoint", "err", err)
+			return opentracing.NoopTracer{}, nopCloser{}
+		}
+		nativeTracer, err := zipkin.NewTracer(reporter, zipkin.WithLocalEndpoint(endpoint))
+		if err != nil {
+			logger.Log("during", "zipkin.NewTracer", "err", err)
+			return opentracing.NoopTracer{}, nopCloser{}
+		}
+		return zipkintracer.Wrap(nativeTracer), reporter
+
+	default:
+		return opentracing.NoopTracer{}, nopCloser{}
+	}
+}
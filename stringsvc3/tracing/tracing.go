@@ -0,0 +1,37 @@
+// Package tracing wraps an endpoint in an OpenTracing span, the same way
+// loggingMiddleware wraps a StringService in logging.
+package tracing
+
+import (
+	"context"
+
+	opentracing "github.com/opentracing/opentracing-go"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// TraceServer returns an endpoint.Middleware that starts a span named
+// operationName around every call. If ctx already carries a span it is
+// made the parent, so proxied calls still show up as one connected trace.
+func TraceServer(tracer opentracing.Tracer, operationName string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			var span opentracing.Span
+			if parent := opentracing.SpanFromContext(ctx); parent != nil {
+				span = tracer.StartSpan(operationName, opentracing.ChildOf(parent.Context()))
+			} else {
+				// no parent span in ctx - this is the root of the trace
+				span = tracer.StartSpan(operationName)
+			}
+			defer span.Finish()
+			ctx = opentracing.ContextWithSpan(ctx, span)
+
+			response, err := next(ctx, request)
+			if err != nil {
+				span.SetTag("error", true)
+				span.LogKV("event", "error", "message", err.Error())
+			}
+			return response, err
+		}
+	}
+}